@@ -0,0 +1,299 @@
+package redis
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/redis.v3"
+)
+
+// redisPusher is the subset of the Redis client batchWriter depends on,
+// extracted so tests can substitute a fake client to simulate a Redis
+// outage.
+type redisPusher interface {
+	RPush(key string, values ...string) error
+}
+
+// clientPusher adapts *redis.Client to redisPusher.
+type clientPusher struct {
+	client *redis.Client
+}
+
+func (c clientPusher) RPush(key string, values ...string) error {
+	return c.client.RPush(key, values...).Err()
+}
+
+// batchWriterStats is a snapshot of a batchWriter's cumulative counters.
+type batchWriterStats struct {
+	Enqueued int64
+	Dropped  int64
+	Spilled  int64
+	Drained  int64
+}
+
+// batchWriter accumulates messages and ships them to Redis in batches via
+// a single RPUSH pipeline (REDIS_BATCH_SIZE, REDIS_BATCH_FLUSH_MS). When
+// a push fails, the pending batch is rotated onto a bounded, segmented
+// on-disk log under spillDir instead of being lost; on the next flush,
+// existing segments are drained back into Redis, oldest first, before any
+// new in-memory batch is sent. Segments are checksummed and only removed
+// after Redis has acknowledged them, so a crash mid-drain re-sends rather
+// than loses a segment (at-least-once delivery).
+type batchWriter struct {
+	client        redisPusher
+	key           string
+	batchSize     int
+	flushInterval time.Duration
+	spillDir      string
+	maxSpillBytes int64
+
+	mu   sync.Mutex
+	buf  []string
+	quit chan struct{}
+	wg   sync.WaitGroup
+
+	// flushMu serializes flush() end to end (including drainSegments),
+	// since it runs both from Enqueue's batch-full path and from loop's
+	// ticker/quit cases, possibly on different goroutines at once.
+	// Without it, two concurrent flushes can glob and RPush the same
+	// spill segment before either removes it, delivering it twice.
+	flushMu sync.Mutex
+
+	enqueued, dropped, spilled, drained int64
+}
+
+func newBatchWriter(client redisPusher, key string, batchSize int, flushInterval time.Duration, spillDir string, maxSpillBytes int64) *batchWriter {
+	if spillDir != "" {
+		if err := os.MkdirAll(spillDir, 0755); err != nil {
+			log.Println("redis: could not create spill dir, spilling disabled:", err)
+			spillDir = ""
+		}
+	}
+
+	w := &batchWriter{
+		client:        client,
+		key:           key,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		spillDir:      spillDir,
+		maxSpillBytes: maxSpillBytes,
+		quit:          make(chan struct{}),
+	}
+	w.wg.Add(1)
+	go w.loop()
+	return w
+}
+
+// Enqueue buffers msg, flushing immediately once batchSize is reached.
+func (w *batchWriter) Enqueue(msg string) {
+	w.mu.Lock()
+	w.buf = append(w.buf, msg)
+	full := len(w.buf) >= w.batchSize
+	w.mu.Unlock()
+
+	atomic.AddInt64(&w.enqueued, 1)
+
+	if full {
+		w.flush()
+	}
+}
+
+// Stop flushes any pending batch and stops the periodic flush loop.
+func (w *batchWriter) Stop() {
+	close(w.quit)
+	w.wg.Wait()
+}
+
+// Stats returns a snapshot of the writer's cumulative counters.
+func (w *batchWriter) Stats() batchWriterStats {
+	return batchWriterStats{
+		Enqueued: atomic.LoadInt64(&w.enqueued),
+		Dropped:  atomic.LoadInt64(&w.dropped),
+		Spilled:  atomic.LoadInt64(&w.spilled),
+		Drained:  atomic.LoadInt64(&w.drained),
+	}
+}
+
+func (w *batchWriter) loop() {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.flush()
+		case <-w.quit:
+			w.flush()
+			return
+		}
+	}
+}
+
+// flush drains any on-disk segments first, then pushes the current
+// in-memory batch. If a segment is still rejected, the in-memory batch is
+// spilled behind it instead of being pushed, so it is never sent ahead of
+// older messages. A push failure likewise spills the in-memory batch to
+// disk rather than dropping it outright. Guarded by flushMu so a caller-
+// triggered flush (batch full) and the periodic ticker flush can never
+// run concurrently and double-drain the same segment.
+func (w *batchWriter) flush() {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	drained := w.drainSegments()
+
+	w.mu.Lock()
+	batch := w.buf
+	w.buf = nil
+	w.mu.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+
+	if !drained {
+		w.spill(batch)
+		return
+	}
+
+	if err := w.client.RPush(w.key, batch...); err != nil {
+		log.Println("redis: push failed, spilling batch to disk:", err)
+		w.spill(batch)
+	}
+}
+
+// spill persists batch as a checksummed segment file, dropping the
+// oldest segments first if spillDir would exceed maxSpillBytes.
+func (w *batchWriter) spill(batch []string) {
+	if w.spillDir == "" {
+		atomic.AddInt64(&w.dropped, int64(len(batch)))
+		log.Println("redis: no spill dir configured, dropping", len(batch), "messages")
+		return
+	}
+
+	payload := strings.Join(batch, "\n") + "\n"
+	sum := sha256.Sum256([]byte(payload))
+	data := []byte(payload + "#sha256:" + hex.EncodeToString(sum[:]) + "\n")
+
+	w.enforceSpillCap(int64(len(data)))
+
+	name := filepath.Join(w.spillDir, fmt.Sprintf("%020d.seg", time.Now().UnixNano()))
+	if err := ioutil.WriteFile(name, data, 0644); err != nil {
+		atomic.AddInt64(&w.dropped, int64(len(batch)))
+		log.Println("redis: could not spill batch to disk:", err)
+		return
+	}
+	atomic.AddInt64(&w.spilled, int64(len(batch)))
+}
+
+// drainSegments re-sends spilled segments to Redis in order, oldest
+// first, stopping at the first one Redis still rejects. It reports
+// whether no segment is left pending.
+func (w *batchWriter) drainSegments() bool {
+	if w.spillDir == "" {
+		return true
+	}
+	for _, seg := range w.segments() {
+		batch, err := readSegment(seg)
+		if err != nil {
+			log.Println("redis: discarding corrupt spill segment", seg, ":", err)
+			os.Remove(seg)
+			continue
+		}
+
+		if err := w.client.RPush(w.key, batch...); err != nil {
+			return false
+		}
+
+		if err := os.Remove(seg); err != nil {
+			log.Println("redis: drained segment but could not remove it:", seg, err)
+		}
+		atomic.AddInt64(&w.drained, int64(len(batch)))
+	}
+	return true
+}
+
+// enforceSpillCap removes the oldest segments until the spill directory,
+// plus incoming bytes, fits within maxSpillBytes. Dropped is tallied in
+// messages, same as spill/drainSegments, not segments, so Stats().Dropped
+// stays comparable across both eviction paths.
+func (w *batchWriter) enforceSpillCap(incoming int64) {
+	if w.maxSpillBytes <= 0 {
+		return
+	}
+
+	segments := w.segments()
+	sizes := make(map[string]int64, len(segments))
+	var total int64
+	for _, s := range segments {
+		if fi, err := os.Stat(s); err == nil {
+			sizes[s] = fi.Size()
+			total += fi.Size()
+		}
+	}
+
+	for total+incoming > w.maxSpillBytes && len(segments) > 0 {
+		oldest := segments[0]
+		segments = segments[1:]
+
+		messages := 1 // best-effort fallback if the segment can't be read back
+		if batch, err := readSegment(oldest); err == nil {
+			messages = len(batch)
+		}
+
+		if err := os.Remove(oldest); err == nil {
+			total -= sizes[oldest]
+			atomic.AddInt64(&w.dropped, int64(messages))
+			log.Println("redis: spill directory over capacity, dropped oldest segment", oldest, "(", messages, "messages)")
+		}
+	}
+}
+
+// segments lists this writer's on-disk segment files, oldest first. The
+// timestamp-based filenames (see spill) sort chronologically.
+func (w *batchWriter) segments() []string {
+	matches, err := filepath.Glob(filepath.Join(w.spillDir, "*.seg"))
+	if err != nil {
+		return nil
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// readSegment loads a segment file and verifies its trailing checksum
+// line, returning the batch of messages it holds.
+func readSegment(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) < 1 {
+		return nil, fmt.Errorf("empty segment")
+	}
+
+	checksumLine := lines[len(lines)-1]
+	if !strings.HasPrefix(checksumLine, "#sha256:") {
+		return nil, fmt.Errorf("missing checksum")
+	}
+
+	batch := lines[:len(lines)-1]
+	payload := strings.Join(batch, "\n") + "\n"
+	sum := sha256.Sum256([]byte(payload))
+	if got, want := hex.EncodeToString(sum[:]), strings.TrimPrefix(checksumLine, "#sha256:"); got != want {
+		return nil, fmt.Errorf("checksum mismatch")
+	}
+
+	return batch, nil
+}
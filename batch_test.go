@@ -0,0 +1,132 @@
+package redis
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePusher is a redisPusher whose RPush calls can be made to fail on
+// demand, to simulate a Redis outage.
+type fakePusher struct {
+	mu     sync.Mutex
+	fail   bool
+	pushed [][]string
+}
+
+func (f *fakePusher) RPush(key string, values ...string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail {
+		return fmt.Errorf("redis down")
+	}
+	f.pushed = append(f.pushed, append([]string(nil), values...))
+	return nil
+}
+
+func (f *fakePusher) setFail(fail bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fail = fail
+}
+
+func (f *fakePusher) pushes() [][]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([][]string(nil), f.pushed...)
+}
+
+func TestBatchWriterSpillsOnRedisFailureThenDrainsInOrder(t *testing.T) {
+	assert := assert.New(t)
+
+	client := &fakePusher{fail: true}
+	spillDir := t.TempDir()
+
+	w := newBatchWriter(client, "logstash", 2, time.Hour, spillDir, 0)
+
+	w.Enqueue("a")
+	w.Enqueue("b") // batch full, flush attempted, push fails -> spills
+	w.Enqueue("c")
+	w.Enqueue("d") // second spilled segment
+
+	assert.Len(w.segments(), 2)
+	assert.Equal(int64(0), w.Stats().Drained)
+	assert.Equal(int64(4), w.Stats().Spilled)
+
+	client.setFail(false)
+
+	w.Enqueue("e")
+	w.Enqueue("f") // flush: drains both spilled segments, then pushes e,f
+
+	assert.Len(w.segments(), 0)
+	assert.Equal(
+		[][]string{{"a", "b"}, {"c", "d"}, {"e", "f"}},
+		client.pushes(),
+	)
+	assert.Equal(int64(4), w.Stats().Drained)
+
+	w.Stop()
+}
+
+func TestBatchWriterConcurrentFlushesDoNotDoubleDrainASegment(t *testing.T) {
+	assert := assert.New(t)
+
+	client := &fakePusher{}
+	spillDir := t.TempDir()
+	w := newBatchWriter(client, "logstash", 1000, time.Hour, spillDir, 0)
+
+	w.spill([]string{"x", "y"})
+	assert.Len(w.segments(), 1)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.flush()
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal([][]string{{"x", "y"}}, client.pushes())
+	assert.Len(w.segments(), 0)
+	assert.Equal(int64(2), w.Stats().Drained)
+
+	w.Stop()
+}
+
+func TestBatchWriterDropsWithoutSpillDir(t *testing.T) {
+	assert := assert.New(t)
+
+	client := &fakePusher{fail: true}
+	w := newBatchWriter(client, "logstash", 1, time.Hour, "", 0)
+
+	w.Enqueue("a")
+
+	assert.Equal(int64(1), w.Stats().Dropped)
+	assert.Equal(int64(0), w.Stats().Spilled)
+
+	w.Stop()
+}
+
+func TestBatchWriterDropsOldestSegmentInMessagesNotSegments(t *testing.T) {
+	assert := assert.New(t)
+
+	client := &fakePusher{fail: true}
+	spillDir := t.TempDir()
+	w := newBatchWriter(client, "logstash", 1000, time.Hour, spillDir, 0)
+
+	w.spill([]string{"a", "b", "c"}) // one 3-message segment, evicted below
+	assert.Len(w.segments(), 1)
+
+	w.maxSpillBytes = 1 // force enforceSpillCap to evict on the next spill
+	w.spill([]string{"d"})
+
+	assert.Len(w.segments(), 1)
+	assert.Equal(int64(3), w.Stats().Dropped)
+
+	w.Stop()
+}
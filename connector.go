@@ -0,0 +1,226 @@
+package redis
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+
+	"github.com/gliderlabs/logspout/router"
+	"gopkg.in/redis.v3"
+)
+
+// redisConnector builds a redisPusher for a particular Redis topology,
+// chosen once at startup by newConnector based on the REDIS_* options.
+// The three implementations below let NewRedisAdapter stay oblivious to
+// whether it's talking to a single node, a Sentinel-monitored master, or
+// a Cluster.
+type redisConnector interface {
+	Connect() (redisPusher, error)
+}
+
+// commandProcessor is the subset of the redis.v3 client types needed to
+// issue a raw AUTH command for Redis 6 ACL (username + password) logins;
+// Options.Password alone only covers the legacy single-password AUTH.
+// redis.v3's Process doesn't return an error itself — the result lands on
+// the Cmder, read back via its Err() method.
+type commandProcessor interface {
+	Process(cmd redis.Cmder)
+}
+
+func authenticateACL(p commandProcessor, username, password string) error {
+	if username == "" {
+		return nil
+	}
+	cmd := redis.NewStatusCmd("AUTH", username, password)
+	p.Process(cmd)
+	return cmd.Err()
+}
+
+// legacyPassword returns the password to put on Options.Password, which
+// triggers the client's automatic single-arg `AUTH <password>` on every
+// new pooled connection. That legacy AUTH has no username and fails
+// against a Redis 6 ACL setup where the default user is left on nopass
+// (the common case REDIS_USERNAME is meant for) — so once a username is
+// configured, auth goes exclusively through authenticateACL's `AUTH user
+// pass` instead.
+func legacyPassword(username, password string) string {
+	if username != "" {
+		return ""
+	}
+	return password
+}
+
+// buildTLSConfig returns the *tls.Config requested via REDIS_TLS and
+// friends, or nil if REDIS_TLS isn't enabled.
+func buildTLSConfig() (*tls.Config, error) {
+	if getopt("REDIS_TLS", "") != "1" {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{
+		InsecureSkipVerify: getopt("REDIS_TLS_SKIP_VERIFY", "") == "1",
+	}
+
+	if ca := getopt("REDIS_TLS_CA", ""); ca != "" {
+		pem, err := ioutil.ReadFile(ca)
+		if err != nil {
+			return nil, fmt.Errorf("redis: reading REDIS_TLS_CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("redis: no certificates found in %s", ca)
+		}
+		cfg.RootCAs = pool
+	}
+
+	certPath, keyPath := getopt("REDIS_TLS_CERT", ""), getopt("REDIS_TLS_KEY", "")
+	if certPath != "" && keyPath != "" {
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("redis: loading REDIS_TLS_CERT/REDIS_TLS_KEY: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// tlsDialer returns an Options.Dialer that dials addr over TLS using cfg.
+// gopkg.in/redis.v3 predates the client's built-in TLSConfig option, so
+// this Dialer hook is the only way to get an encrypted connection out of
+// it.
+func tlsDialer(addr string, cfg *tls.Config) func() (net.Conn, error) {
+	return func() (net.Conn, error) {
+		return tls.Dial("tcp", addr, cfg)
+	}
+}
+
+// newConnector picks the single-node, Sentinel, or Cluster connector for
+// this route based on REDIS_SENTINELS, REDIS_CLUSTER, and route.Address.
+func newConnector(route *router.Route) (redisConnector, error) {
+	tlsConfig, err := buildTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	username := getopt("REDIS_USERNAME", "")
+	password := getopt("REDIS_PASSWORD", "")
+
+	if sentinels := splitCsv(getopt("REDIS_SENTINELS", "")); len(sentinels) > 0 {
+		if tlsConfig != nil {
+			return nil, fmt.Errorf("redis: REDIS_TLS is not supported together with REDIS_SENTINELS")
+		}
+		return sentinelConnector{
+			sentinelAddrs: sentinels,
+			masterName:    getopt("REDIS_MASTER_NAME", "mymaster"),
+			username:      username,
+			password:      password,
+		}, nil
+	}
+
+	if getopt("REDIS_CLUSTER", "") == "1" {
+		if tlsConfig != nil {
+			return nil, fmt.Errorf("redis: REDIS_TLS is not supported together with REDIS_CLUSTER")
+		}
+		addrs := splitCsv(getopt("REDIS_HOST", ""))
+		if len(addrs) == 0 && route.Address != "" {
+			addrs = []string{route.Address}
+		}
+		return clusterConnector{
+			addrs:    addrs,
+			username: username,
+			password: password,
+		}, nil
+	}
+
+	address := route.Address
+	if address == "" {
+		address = getopt("REDIS_HOST", "localhost") + ":" + getopt("REDIS_PORT", "6379")
+	}
+	return singleNodeConnector{
+		addr:     address,
+		username: username,
+		password: password,
+		tls:      tlsConfig,
+	}, nil
+}
+
+// singleNodeConnector talks to one Redis endpoint directly.
+type singleNodeConnector struct {
+	addr     string
+	username string
+	password string
+	tls      *tls.Config
+}
+
+func (c singleNodeConnector) Connect() (redisPusher, error) {
+	opts := &redis.Options{
+		Addr:     c.addr,
+		Password: legacyPassword(c.username, c.password),
+	}
+	if c.tls != nil {
+		opts.Dialer = tlsDialer(c.addr, c.tls)
+	}
+	client := redis.NewClient(opts)
+	if err := authenticateACL(client, c.username, c.password); err != nil {
+		return nil, err
+	}
+	return clientPusher{client}, nil
+}
+
+// sentinelConnector resolves the current master through a set of Redis
+// Sentinel instances and reconnects automatically on failover. TLS isn't
+// supported here: redis.v3's FailoverOptions has no Dialer hook of its
+// own to wire an encrypted connection through (newConnector rejects
+// REDIS_TLS+REDIS_SENTINELS before a connector is ever built).
+type sentinelConnector struct {
+	sentinelAddrs []string
+	masterName    string
+	username      string
+	password      string
+}
+
+func (c sentinelConnector) Connect() (redisPusher, error) {
+	client := redis.NewFailoverClient(&redis.FailoverOptions{
+		MasterName:    c.masterName,
+		SentinelAddrs: c.sentinelAddrs,
+		Password:      legacyPassword(c.username, c.password),
+	})
+	if err := authenticateACL(client, c.username, c.password); err != nil {
+		return nil, err
+	}
+	return clientPusher{client}, nil
+}
+
+// clusterConnector talks to a Redis Cluster from a seed address list,
+// hashing the configured list key to the right slot; the underlying
+// redis.v3 ClusterClient refreshes its slot map on MOVED/ASK redirects.
+// TLS isn't supported here for the same reason as sentinelConnector
+// (newConnector rejects REDIS_TLS+REDIS_CLUSTER up front).
+type clusterConnector struct {
+	addrs    []string
+	username string
+	password string
+}
+
+func (c clusterConnector) Connect() (redisPusher, error) {
+	client := redis.NewClusterClient(&redis.ClusterOptions{
+		Addrs:    c.addrs,
+		Password: legacyPassword(c.username, c.password),
+	})
+	if err := authenticateACL(client, c.username, c.password); err != nil {
+		return nil, err
+	}
+	return clusterPusher{client}, nil
+}
+
+// clusterPusher adapts *redis.ClusterClient to redisPusher.
+type clusterPusher struct {
+	client *redis.ClusterClient
+}
+
+func (c clusterPusher) RPush(key string, values ...string) error {
+	return c.client.RPush(key, values...).Err()
+}
@@ -0,0 +1,171 @@
+package redis
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gliderlabs/logspout/router"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/redis.v3"
+)
+
+func withEnv(t *testing.T, kv map[string]string, fn func()) {
+	for k, v := range kv {
+		old, had := os.LookupEnv(k)
+		os.Setenv(k, v)
+		defer func(k, old string, had bool) {
+			if had {
+				os.Setenv(k, old)
+			} else {
+				os.Unsetenv(k)
+			}
+		}(k, old, had)
+	}
+	fn()
+}
+
+func TestNewConnectorPicksSingleNodeByDefault(t *testing.T) {
+	assert := assert.New(t)
+
+	withEnv(t, map[string]string{"REDIS_SENTINELS": "", "REDIS_CLUSTER": ""}, func() {
+		c, err := newConnector(&router.Route{Address: "localhost:6379"})
+		assert.NoError(err)
+		single, ok := c.(singleNodeConnector)
+		assert.True(ok)
+		assert.Equal("localhost:6379", single.addr)
+	})
+}
+
+func TestNewConnectorPicksSentinelWhenConfigured(t *testing.T) {
+	assert := assert.New(t)
+
+	withEnv(t, map[string]string{
+		"REDIS_SENTINELS":   "sentinel1:26379,sentinel2:26379",
+		"REDIS_MASTER_NAME": "mymaster",
+	}, func() {
+		c, err := newConnector(&router.Route{})
+		assert.NoError(err)
+		sentinel, ok := c.(sentinelConnector)
+		assert.True(ok)
+		assert.Equal([]string{"sentinel1:26379", "sentinel2:26379"}, sentinel.sentinelAddrs)
+		assert.Equal("mymaster", sentinel.masterName)
+	})
+}
+
+func TestNewConnectorPicksClusterWhenConfigured(t *testing.T) {
+	assert := assert.New(t)
+
+	withEnv(t, map[string]string{
+		"REDIS_SENTINELS": "",
+		"REDIS_CLUSTER":   "1",
+		"REDIS_HOST":      "node1:6379,node2:6379",
+	}, func() {
+		c, err := newConnector(&router.Route{})
+		assert.NoError(err)
+		cluster, ok := c.(clusterConnector)
+		assert.True(ok)
+		assert.Equal([]string{"node1:6379", "node2:6379"}, cluster.addrs)
+	})
+}
+
+func TestNewConnectorRejectsUnreadableTLSCA(t *testing.T) {
+	assert := assert.New(t)
+
+	withEnv(t, map[string]string{
+		"REDIS_SENTINELS": "",
+		"REDIS_CLUSTER":   "",
+		"REDIS_TLS":       "1",
+		"REDIS_TLS_CA":    "/nonexistent/ca.pem",
+	}, func() {
+		_, err := newConnector(&router.Route{Address: "localhost:6379"})
+		assert.Error(err)
+	})
+}
+
+// TestLegacyPasswordOnlyAppliesWithoutUsername guards the Password/ACL
+// conflict: Options.Password must stay empty once a username is set, or
+// go-redis's automatic single-arg AUTH on every pooled connection fights
+// with authenticateACL's two-arg ACL AUTH (see legacyPassword's doc
+// comment).
+func TestLegacyPasswordOnlyAppliesWithoutUsername(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("", legacyPassword("app-user", "secret"))
+	assert.Equal("secret", legacyPassword("", "secret"))
+	assert.Equal("", legacyPassword("", ""))
+}
+
+// fakeCommandProcessor counts the commands it's given, so authenticateACL
+// can be tested without a real Redis server.
+type fakeCommandProcessor struct {
+	processed int
+}
+
+func (f *fakeCommandProcessor) Process(cmd redis.Cmder) {
+	f.processed++
+}
+
+func TestAuthenticateACLSkipsAuthWithoutUsername(t *testing.T) {
+	assert := assert.New(t)
+
+	p := &fakeCommandProcessor{}
+	assert.NoError(authenticateACL(p, "", "secret"))
+	assert.Equal(0, p.processed)
+}
+
+func TestAuthenticateACLIssuesAuthWithUsername(t *testing.T) {
+	assert := assert.New(t)
+
+	p := &fakeCommandProcessor{}
+	assert.NoError(authenticateACL(p, "app-user", "secret"))
+	assert.Equal(1, p.processed)
+}
+
+// TestSentinelConnectorReResolvesMasterOnFailover exercises the connector
+// end to end against a fake Sentinel and two fake Redis masters: it
+// confirms a push reaches whichever master Sentinel currently reports,
+// and that losing the connection to the old master causes the client to
+// re-query Sentinel and pick up the new one, rather than caching the
+// failed address forever.
+func TestSentinelConnectorReResolvesMasterOnFailover(t *testing.T) {
+	assert := assert.New(t)
+
+	masterA := &fakeMaster{}
+	srvA := startRespServer(t, masterA.handle)
+	defer srvA.close()
+
+	masterB := &fakeMaster{}
+	srvB := startRespServer(t, masterB.handle)
+	defer srvB.close()
+
+	sentinel := &fakeSentinel{}
+	sentinel.setMaster(srvA.addr())
+	srvSentinel := startRespServer(t, sentinel.handle)
+	defer srvSentinel.close()
+
+	connector := sentinelConnector{
+		sentinelAddrs: []string{srvSentinel.addr()},
+		masterName:    "mymaster",
+	}
+
+	pusher, err := connector.Connect()
+	assert.NoError(err)
+	assert.NoError(pusher.RPush("logstash", "a", "b"))
+	assert.Equal([][]string{{"a", "b"}}, masterA.pushes())
+
+	// Simulate master A failing and Sentinel promoting B in its place.
+	srvA.close()
+	sentinel.setMaster(srvB.addr())
+
+	deadline := time.Now().Add(time.Second)
+	var pushErr error
+	for time.Now().Before(deadline) {
+		if pushErr = pusher.RPush("logstash", "c"); pushErr == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.NoError(pushErr, "client never re-resolved to the new master")
+	assert.Equal([][]string{{"c"}}, masterB.pushes())
+}
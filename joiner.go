@@ -0,0 +1,161 @@
+package redis
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+// maxJoinLines bounds how many lines (the first line plus its
+// continuations) are buffered for a single pending event, protecting against a container that never emits
+// a line matching newEvent.
+const maxJoinLines = 1000
+
+// lineJoiner merges consecutive router.Message lines that belong to the
+// same logical event (e.g. a multi-line stack trace) into a single
+// message before it reaches createLogstashMessage. A line is treated as
+// a continuation of the previous event for its (container, source)
+// stream unless it matches newEvent. A pending event is flushed early
+// if no continuation arrives within timeout, so a dangling partial
+// event is never held indefinitely.
+type lineJoiner struct {
+	newEvent *regexp.Regexp
+	timeout  time.Duration
+
+	mu      sync.Mutex
+	pending map[string]*joinBuffer
+
+	// wg counts every scheduled flush timer until it is either stopped
+	// before firing or its expire() callback has finished, so Join can
+	// wait for them
+	// before closing out — otherwise a timer racing the upstream channel
+	// close can send on an already-closed out.
+	wg sync.WaitGroup
+}
+
+// joinBuffer accumulates the lines of one in-flight event for a single
+// (container, source) stream.
+type joinBuffer struct {
+	message *router.Message
+	lines   []string
+	timer   *time.Timer
+}
+
+func newLineJoiner(pattern string, timeout time.Duration) *lineJoiner {
+	return &lineJoiner{
+		newEvent: regexp.MustCompile(pattern),
+		timeout:  timeout,
+		pending:  make(map[string]*joinBuffer),
+	}
+}
+
+// Join reads from in, merges continuation lines, and writes the
+// resulting messages to the returned channel. The returned channel is
+// closed once in is closed and any pending event has been flushed.
+func (j *lineJoiner) Join(in chan *router.Message) chan *router.Message {
+	out := make(chan *router.Message)
+	go func() {
+		defer close(out)
+		for m := range in {
+			j.submit(m, out)
+		}
+		j.flushAll(out)
+		j.wg.Wait()
+	}()
+	return out
+}
+
+func joinKey(m *router.Message) string {
+	return m.Container.ID + "|" + m.Source
+}
+
+func (j *lineJoiner) submit(m *router.Message, out chan *router.Message) {
+	j.mu.Lock()
+	key := joinKey(m)
+	buf, pending := j.pending[key]
+
+	if pending && !j.newEvent.MatchString(m.Data) && len(buf.lines) < maxJoinLines {
+		// Replace the buffer (and its timer) wholesale rather than
+		// mutating buf.timer with Reset: Reset on an AfterFunc timer
+		// that has already fired reschedules the *same* expire() call
+		// to run again later, which would fire twice for the one
+		// wg.Add below. Stopping and requeuing a fresh joinBuffer +
+		// timer keeps every wg.Add paired with exactly one expire().
+		if buf.timer.Stop() {
+			j.wg.Done()
+		}
+		next := &joinBuffer{message: buf.message, lines: append(buf.lines, m.Data)}
+		j.wg.Add(1)
+		next.timer = time.AfterFunc(j.timeout, func() { j.expire(key, next, out) })
+		j.pending[key] = next
+		j.mu.Unlock()
+		return
+	}
+
+	var flushed *router.Message
+	if pending {
+		if buf.timer.Stop() {
+			// Timer hadn't fired, so its expire() will never run —
+			// account for it ourselves.
+			j.wg.Done()
+		}
+		flushed = buf.flush()
+		delete(j.pending, key)
+	}
+
+	next := &joinBuffer{message: m, lines: []string{m.Data}}
+	j.wg.Add(1)
+	next.timer = time.AfterFunc(j.timeout, func() { j.expire(key, next, out) })
+	j.pending[key] = next
+	j.mu.Unlock()
+
+	if flushed != nil {
+		out <- flushed
+	}
+}
+
+// expire is called from the buffer's flush timer, on its own goroutine.
+// It only flushes if next is still the current buffer for key, i.e. no
+// later line replaced or flushed it in the meantime.
+// The deferred wg.Done pairs with the wg.Add in submit, so Join can wait
+// for every in-flight expire before it closes out.
+func (j *lineJoiner) expire(key string, next *joinBuffer, out chan *router.Message) {
+	defer j.wg.Done()
+
+	j.mu.Lock()
+	if j.pending[key] != next {
+		j.mu.Unlock()
+		return
+	}
+	delete(j.pending, key)
+	j.mu.Unlock()
+
+	out <- next.flush()
+}
+
+func (j *lineJoiner) flushAll(out chan *router.Message) {
+	j.mu.Lock()
+	bufs := j.pending
+	j.pending = make(map[string]*joinBuffer)
+	j.mu.Unlock()
+
+	for _, buf := range bufs {
+		if buf.timer.Stop() {
+			// Timer hadn't fired, so its expire() will never run —
+			// account for it ourselves.
+			j.wg.Done()
+		}
+		out <- buf.flush()
+	}
+}
+
+// flush renders the buffered lines as a single router.Message, joined
+// with newlines.
+func (b *joinBuffer) flush() *router.Message {
+	merged := *b.message
+	merged.Data = strings.Join(b.lines, "\n")
+	return &merged
+}
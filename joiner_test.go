@@ -0,0 +1,135 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/gliderlabs/logspout/router"
+	"github.com/stretchr/testify/assert"
+)
+
+func testMessage(data string, offset time.Duration) *router.Message {
+	return &router.Message{
+		Container: &docker.Container{
+			ID:   "6feffd9428dc",
+			Name: "/my_app",
+			Config: &docker.Config{
+				Hostname: "container_hostname",
+				Image:    "my.registry.host:443/path/to/image:1234",
+			},
+		},
+		Source: "stdout",
+		Data:   data,
+		Time:   time.Unix(int64(1453818496), 0).Add(offset),
+	}
+}
+
+func TestLineJoinerMergesContinuationLines(t *testing.T) {
+	assert := assert.New(t)
+
+	j := newLineJoiner(defaultJoinPattern, 500*time.Millisecond)
+	in := make(chan *router.Message)
+	out := j.Join(in)
+
+	go func() {
+		in <- testMessage("Exception in thread \"main\" java.lang.RuntimeException: boom", 0)
+		in <- testMessage("    at com.example.Main.main(Main.java:10)", time.Millisecond)
+		in <- testMessage("    at com.example.Main.run(Main.java:20)", 2*time.Millisecond)
+		in <- testMessage("next event entirely", 3*time.Millisecond)
+		close(in)
+	}()
+
+	first := <-out
+	assert.Equal(
+		"Exception in thread \"main\" java.lang.RuntimeException: boom\n"+
+			"    at com.example.Main.main(Main.java:10)\n"+
+			"    at com.example.Main.run(Main.java:20)",
+		first.Data,
+	)
+
+	second := <-out
+	assert.Equal("next event entirely", second.Data)
+
+	_, ok := <-out
+	assert.False(ok)
+}
+
+func TestLineJoinerFlushesOnTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	j := newLineJoiner(defaultJoinPattern, 20*time.Millisecond)
+	in := make(chan *router.Message)
+	out := j.Join(in)
+
+	go func() {
+		in <- testMessage("dangling event with no follow-up", 0)
+	}()
+
+	select {
+	case m := <-out:
+		assert.Equal("dangling event with no follow-up", m.Data)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for flush")
+	}
+
+	close(in)
+	_, ok := <-out
+	assert.False(ok)
+}
+
+// TestLineJoinerDoesNotPanicWithRapidContinuationLines guards against
+// submit's continuation branch double-firing a single wg.Add: rapid
+// continuation lines land close enough to the flush deadline that some
+// race the timer's own expire() callback. Run under `go test -race` to
+// catch a resurfacing of that bug reliably.
+func TestLineJoinerDoesNotPanicWithRapidContinuationLines(t *testing.T) {
+	assert := assert.New(t)
+
+	for i := 0; i < 50; i++ {
+		j := newLineJoiner(defaultJoinPattern, time.Millisecond)
+		in := make(chan *router.Message)
+		out := j.Join(in)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			var got []string
+			for m := range out {
+				got = append(got, m.Data)
+			}
+			assert.NotEmpty(got)
+		}()
+
+		in <- testMessage("first line of event", 0)
+		for n := 0; n < 20; n++ {
+			in <- testMessage("    continuation line", time.Duration(n)*time.Microsecond)
+		}
+		close(in)
+		<-done
+	}
+}
+
+// TestLineJoinerDoesNotPanicWhenInClosesNearTimerDeadline guards against a
+// send on the closed out channel: in closes (ending Join's goroutine and
+// triggering flushAll) right around the moment the pending buffer's flush
+// timer fires on its own goroutine. Run repeatedly under `go test -race`
+// to catch the race reliably.
+func TestLineJoinerDoesNotPanicWhenInClosesNearTimerDeadline(t *testing.T) {
+	assert := assert.New(t)
+
+	for i := 0; i < 50; i++ {
+		j := newLineJoiner(defaultJoinPattern, time.Millisecond)
+		in := make(chan *router.Message)
+		out := j.Join(in)
+
+		in <- testMessage("first line of event", 0)
+		close(in)
+
+		var got []string
+		for m := range out {
+			got = append(got, m.Data)
+		}
+		assert.Equal([]string{"first line of event"}, got)
+	}
+}
@@ -0,0 +1,422 @@
+package redis
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gliderlabs/logspout/router"
+)
+
+// defaultJoinPattern/defaultJoinTimeout configure the multi-line joiner
+// when REDIS_MULTILINE_PATTERN/REDIS_MULTILINE_TIMEOUT_MS are unset.
+const (
+	defaultJoinPattern = `^\S`
+	defaultJoinTimeout = 500 * time.Millisecond
+)
+
+func init() {
+	router.AdapterFactories.Register(NewRedisAdapter, "redis")
+}
+
+var (
+	debug = os.Getenv("DEBUG") != ""
+
+	// dockerLabels and dockerEnvs are the user-configured whitelists of
+	// container labels / environment variables to mirror into the
+	// outgoing message under docker.labels / docker.env. Empty by
+	// default, i.e. no enrichment unless explicitly opted into.
+	dockerLabels = splitCsv(getopt("REDIS_DOCKER_LABELS", ""))
+	dockerEnvs   = splitCsv(getopt("REDIS_DOCKER_ENV", ""))
+
+	// validLogTypes restricts which values of a JSON "logtype" field are
+	// promoted to the top-level "logtype" field of the outgoing message.
+	validLogTypes = splitCsv(getopt("REDIS_LOGTYPES", ""))
+)
+
+// ecsVersion is the ECS schema version stamped onto messages built by
+// createEcsMessage.
+const ecsVersion = "1.6.0"
+
+// RedisAdapter streams router.Message values to a Redis list as
+// Logstash- or ECS-compatible JSON documents.
+type RedisAdapter struct {
+	route        *router.Route
+	batch        *batchWriter
+	dockerHost   string
+	useV0        bool
+	logstashType string
+	ecsSchema    bool
+	joiner       *lineJoiner
+}
+
+// defaultBatchSize/defaultBatchFlush/defaultSpillMaxBytes configure the
+// batchWriter when REDIS_BATCH_SIZE/REDIS_BATCH_FLUSH_MS/
+// REDIS_SPILL_MAX_BYTES are unset.
+const (
+	defaultBatchSize     = 100
+	defaultBatchFlush    = 1000 * time.Millisecond
+	defaultSpillMaxBytes = 64 << 20 // 64MB
+)
+
+// NewRedisAdapter builds a RedisAdapter for the given route, reading its
+// Redis connection and formatting options from the route address and the
+// REDIS_* environment variables.
+func NewRedisAdapter(route *router.Route) (router.LogAdapter, error) {
+	connector, err := newConnector(route)
+	if err != nil {
+		return nil, err
+	}
+	pusher, err := connector.Connect()
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, _ := os.Hostname()
+
+	var joiner *lineJoiner
+	if pattern := getopt("REDIS_MULTILINE_PATTERN", defaultJoinPattern); pattern != "" {
+		timeout := defaultJoinTimeout
+		if ms, err := strconv.Atoi(getopt("REDIS_MULTILINE_TIMEOUT_MS", "")); err == nil {
+			timeout = time.Duration(ms) * time.Millisecond
+		}
+		joiner = newLineJoiner(pattern, timeout)
+	}
+
+	batchSize := defaultBatchSize
+	if n, err := strconv.Atoi(getopt("REDIS_BATCH_SIZE", "")); err == nil {
+		batchSize = n
+	}
+	flushInterval := defaultBatchFlush
+	if ms, err := strconv.Atoi(getopt("REDIS_BATCH_FLUSH_MS", "")); err == nil {
+		flushInterval = time.Duration(ms) * time.Millisecond
+	}
+	maxSpillBytes := int64(defaultSpillMaxBytes)
+	if n, err := strconv.ParseInt(getopt("REDIS_SPILL_MAX_BYTES", ""), 10, 64); err == nil {
+		maxSpillBytes = n
+	}
+
+	batch := newBatchWriter(
+		pusher,
+		getopt("REDIS_KEY", "logstash"),
+		batchSize,
+		flushInterval,
+		getopt("REDIS_SPILL_DIR", ""),
+		maxSpillBytes,
+	)
+
+	return &RedisAdapter{
+		route:        route,
+		batch:        batch,
+		dockerHost:   getopt("REDIS_DOCKER_HOST", hostname),
+		useV0:        getopt("REDIS_LOGSTASH_VERSION", "1") == "0",
+		logstashType: getopt("REDIS_LOGSTASH_TYPE", ""),
+		ecsSchema:    getopt("REDIS_LOGSTASH_SCHEMA", "") == "ecs",
+		joiner:       joiner,
+	}, nil
+}
+
+// Stream implements router.LogAdapter, enqueuing each message onto the
+// batch writer for delivery to Redis.
+func (a *RedisAdapter) Stream(logstream chan *router.Message) {
+	in := logstream
+	if a.joiner != nil {
+		in = a.joiner.Join(logstream)
+	}
+
+	for m := range in {
+		var msg []byte
+		var err error
+		if a.ecsSchema {
+			msg, err = createEcsMessage(m, a.dockerHost)
+		} else {
+			msg, err = createLogstashMessage(m, a.dockerHost, a.useV0, a.logstashType)
+		}
+		if err != nil {
+			log.Println("redis: error making message:", err)
+			continue
+		}
+
+		a.batch.Enqueue(string(msg))
+
+		if debug {
+			log.Println("redis: enqueued", string(msg))
+		}
+	}
+
+	a.batch.Stop()
+}
+
+// getopt returns the value of the named environment variable, or the
+// supplied default when it is unset.
+func getopt(name, dfault string) string {
+	value := os.Getenv(name)
+	if value == "" {
+		value = dfault
+	}
+	return value
+}
+
+// splitCsv splits a comma-separated option value into its parts, dropping
+// empty entries. An empty/unset option yields a nil (empty) whitelist.
+func splitCsv(s string) []string {
+	if s == "" {
+		return nil
+	}
+	parts := strings.Split(s, ",")
+	out := make([]string, 0, len(parts))
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// LogstashMessageV0 is the legacy (REDIS_LOGSTASH_VERSION=0) flat message
+// shape, kept for compatibility with older Logstash pipelines.
+type LogstashMessageV0 struct {
+	Type       string `json:"@type,omitempty"`
+	Timestamp  string `json:"@timestamp"`
+	Sourcehost string `json:"host"`
+	Message    string `json:"message"`
+	Name       string `json:"docker_name"`
+	ID         string `json:"docker_id"`
+	Image      string `json:"docker_image"`
+	ImageTag   string `json:"docker_image_tag,omitempty"`
+	Source     string `json:"docker_source"`
+	DockerHost string `json:"docker_host,omitempty"`
+}
+
+// splitImage splits a Docker image reference into its repository and tag,
+// taking care not to mistake a registry's port number for a tag
+// separator (e.g. "my.registry.host:443/path/to/image").
+func splitImage(image string) (string, string) {
+	n := strings.LastIndex(image, ":")
+	if n < 0 {
+		return image, ""
+	}
+	tag := image[n+1:]
+	if strings.Contains(tag, "/") {
+		return image, ""
+	}
+	return image[:n], tag
+}
+
+// validJsonMessage reports whether line is a well-formed JSON object.
+func validJsonMessage(line string) bool {
+	var js map[string]interface{}
+	return json.Unmarshal([]byte(line), &js) == nil
+}
+
+// isValidLogType reports whether logtype is in the configured
+// REDIS_LOGTYPES whitelist.
+func isValidLogType(logtype string) bool {
+	for _, t := range validLogTypes {
+		if t == logtype {
+			return true
+		}
+	}
+	return false
+}
+
+// createLogstashMessage builds the JSON document shipped to Redis for a
+// single router.Message. When the message data is itself a JSON object,
+// its fields (other than "message"/"logtype", which are handled
+// specially) are merged into the outgoing v1 document; the v0 document
+// carries only its fixed fields, so the other JSON fields are dropped.
+func createLogstashMessage(m *router.Message, dockerHost string, useV0 bool, logstashType string) ([]byte, error) {
+	image, imageTag := splitImage(m.Container.Config.Image)
+	name := strings.TrimPrefix(m.Container.Name, "/")
+	timestamp := m.Time.UTC().Format("2006-01-02T15:04:05.000Z")
+
+	message := m.Data
+	var extra map[string]interface{}
+
+	if validJsonMessage(m.Data) {
+		if err := json.Unmarshal([]byte(m.Data), &extra); err != nil {
+			return nil, err
+		}
+		if text, ok := extra["message"]; ok {
+			message = fmt.Sprintf("%v", text)
+		} else {
+			message = "no message"
+		}
+		delete(extra, "message")
+		if logtype, ok := extra["logtype"].(string); !ok || !isValidLogType(logtype) {
+			delete(extra, "logtype")
+		}
+	}
+
+	if useV0 {
+		msg := LogstashMessageV0{
+			Type:       logstashType,
+			Timestamp:  timestamp,
+			Sourcehost: m.Container.Config.Hostname,
+			Message:    message,
+			Name:       name,
+			ID:         m.Container.ID,
+			Image:      image,
+			ImageTag:   imageTag,
+			Source:     m.Source,
+			DockerHost: dockerHost,
+		}
+		return json.Marshal(msg)
+	}
+
+	dockerFields := map[string]interface{}{
+		"name":        name,
+		"cid":         m.Container.ID,
+		"image":       image,
+		"image_tag":   imageTag,
+		"source":      m.Source,
+		"docker_host": dockerHost,
+	}
+
+	if labels := selectLabels(m.Container.Config.Labels); len(labels) > 0 {
+		dockerFields["labels"] = labels
+	}
+	if env := selectEnv(m.Container.Config.Env); len(env) > 0 {
+		dockerFields["env"] = env
+	}
+
+	fields := map[string]interface{}{
+		"@timestamp": timestamp,
+		"host":       m.Container.Config.Hostname,
+		"message":    message,
+		"docker":     dockerFields,
+	}
+	if logstashType != "" {
+		fields["@type"] = logstashType
+	}
+	for k, v := range extra {
+		fields[k] = v
+	}
+
+	return json.Marshal(fields)
+}
+
+// selectLabels returns the subset of labels named in the REDIS_DOCKER_LABELS
+// whitelist.
+func selectLabels(labels map[string]string) map[string]string {
+	if len(dockerLabels) == 0 || len(labels) == 0 {
+		return nil
+	}
+	selected := map[string]string{}
+	for _, k := range dockerLabels {
+		if v, ok := labels[k]; ok {
+			selected[k] = v
+		}
+	}
+	return selected
+}
+
+// selectEnv returns the subset of container environment variables named
+// in the REDIS_DOCKER_ENV whitelist. Entries are given as "KEY=value", as
+// they appear on docker.Container.Config.Env.
+func selectEnv(env []string) map[string]string {
+	if len(dockerEnvs) == 0 || len(env) == 0 {
+		return nil
+	}
+	selected := map[string]string{}
+	for _, kv := range env {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		for _, want := range dockerEnvs {
+			if parts[0] == want {
+				selected[parts[0]] = parts[1]
+			}
+		}
+	}
+	return selected
+}
+
+// createEcsMessage builds an Elastic Common Schema (ECS) JSON document for
+// a single router.Message, selected via REDIS_LOGSTASH_SCHEMA=ecs. When the
+// message data is a JSON object, its "message"/"level"/"file"/"line"
+// fields are mapped onto their ECS equivalents instead of being inlined
+// as-is.
+func createEcsMessage(m *router.Message, dockerHost string) ([]byte, error) {
+	image, imageTag := splitImage(m.Container.Config.Image)
+	name := strings.TrimPrefix(m.Container.Name, "/")
+	timestamp := m.Time.UTC().Format("2006-01-02T15:04:05.000Z")
+
+	message := m.Data
+	var level, file, logtype string
+	var line int
+
+	if validJsonMessage(m.Data) {
+		var extra map[string]interface{}
+		if err := json.Unmarshal([]byte(m.Data), &extra); err != nil {
+			return nil, err
+		}
+		if text, ok := extra["message"]; ok {
+			message = fmt.Sprintf("%v", text)
+		} else {
+			message = "no message"
+		}
+		if v, ok := extra["level"].(string); ok {
+			level = v
+		}
+		if v, ok := extra["file"].(string); ok {
+			file = v
+		}
+		if v, ok := extra["line"].(float64); ok {
+			line = int(v)
+		}
+		if v, ok := extra["logtype"].(string); ok && isValidLogType(v) {
+			logtype = v
+		}
+	}
+
+	fields := map[string]interface{}{
+		"@timestamp": timestamp,
+		"message":    message,
+		"container": map[string]interface{}{
+			"id":   m.Container.ID,
+			"name": name,
+			"image": map[string]interface{}{
+				"name": image,
+				"tag":  imageTag,
+			},
+		},
+		"host": map[string]interface{}{
+			"name":     dockerHost,
+			"hostname": m.Container.Config.Hostname,
+		},
+		"ecs": map[string]interface{}{
+			"version": ecsVersion,
+		},
+	}
+
+	logFields := map[string]interface{}{}
+	if level != "" {
+		logFields["level"] = level
+	}
+	if file != "" || line != 0 {
+		fileFields := map[string]interface{}{}
+		if file != "" {
+			fileFields["name"] = file
+		}
+		if line != 0 {
+			fileFields["line"] = line
+		}
+		logFields["origin"] = map[string]interface{}{"file": fileFields}
+	}
+	if len(logFields) > 0 {
+		fields["log"] = logFields
+	}
+
+	if logtype != "" {
+		fields["event"] = map[string]interface{}{"dataset": logtype}
+	}
+
+	return json.Marshal(fields)
+}
@@ -76,6 +76,47 @@ func TestCreateLogstashMessageV1(t *testing.T) {
 
 }
 
+func TestCreateLogstashMessageV1WithLabelsAndEnv(t *testing.T) {
+
+	assert := assert.New(t)
+
+	origLabels, origEnvs := dockerLabels, dockerEnvs
+	dockerLabels = []string{"app", "env"}
+	dockerEnvs = []string{"VERSION"}
+	defer func() {
+		dockerLabels, dockerEnvs = origLabels, origEnvs
+	}()
+
+	m := router.Message{
+		Container: &docker.Container{
+			ID:   "6feffd9428dc",
+			Name: "/my_app",
+			Config: &docker.Config{
+				Hostname: "container_hostname",
+				Image:    "my.registry.host:443/path/to/image:1234",
+				Labels: map[string]string{
+					"app":  "checkout",
+					"team": "payments",
+				},
+				Env: []string{"VERSION=1.2.3", "REGION=us-east-1"},
+			},
+		},
+		Source: "stdout",
+		Data:   "hello world",
+		Time:   time.Unix(int64(1453818496), 595000000),
+	}
+
+	msg, _ := createLogstashMessage(&m, "tst-mesos-slave-001", false, "my-type")
+	jq := makeQuery(msg)
+
+	assert.Equal("checkout", getString(jq, "docker", "labels", "app"))
+	assert.Equal("", getString(jq, "docker", "labels", "env"))
+	assert.Equal("", getString(jq, "docker", "labels", "team"))
+	assert.Equal("1.2.3", getString(jq, "docker", "env", "VERSION"))
+	assert.Equal("", getString(jq, "docker", "env", "REGION"))
+
+}
+
 func TestCreateLogstashMessageOptionalType(t *testing.T) {
 
 	assert := assert.New(t)
@@ -210,6 +251,119 @@ func TestCreateLogstashMessageWithJsonDataAndUnknownLogtype(t *testing.T) {
 
 }
 
+func TestCreateEcsMessage(t *testing.T) {
+
+	assert := assert.New(t)
+
+	m := router.Message{
+		Container: &docker.Container{
+			ID:   "6feffd9428dc",
+			Name: "/my_app",
+			Config: &docker.Config{
+				Hostname: "container_hostname",
+				Image:    "my.registry.host:443/path/to/image:1234",
+			},
+		},
+		Source: "stdout",
+		Data:   "hello world",
+		Time:   time.Unix(int64(1453818496), 595000000),
+	}
+
+	msg, _ := createEcsMessage(&m, "tst-mesos-slave-001")
+	jq := makeQuery(msg)
+
+	assert.Equal("1.6.0", getString(jq, "ecs", "version"))
+	assert.Equal("2016-01-26T14:28:16.595Z", getString(jq, "@timestamp"))
+	assert.Equal("hello world", getString(jq, "message"))
+	assert.Equal("6feffd9428dc", getString(jq, "container", "id"))
+	assert.Equal("my_app", getString(jq, "container", "name"))
+	assert.Equal("my.registry.host:443/path/to/image", getString(jq, "container", "image", "name"))
+	assert.Equal("1234", getString(jq, "container", "image", "tag"))
+	assert.Equal("tst-mesos-slave-001", getString(jq, "host", "name"))
+	assert.Equal("container_hostname", getString(jq, "host", "hostname"))
+	assert.Equal("", getString(jq, "event", "dataset"))
+
+}
+
+func TestCreateEcsMessageWithJsonData(t *testing.T) {
+
+	assert := assert.New(t)
+
+	m := router.Message{
+		Container: &docker.Container{
+			ID:   "6feffd9428dc",
+			Name: "/my_app",
+			Config: &docker.Config{
+				Hostname: "container_hostname",
+				Image:    "my.registry.host:443/path/to/image:1234",
+			},
+		},
+		Source: "stdout",
+		Data:   `{"logtype": "applog", "message":"something happened", "level": "DEBUG", "file": "debug.go", "line": 42}`,
+		Time:   time.Unix(int64(1453818496), 595000000),
+	}
+
+	msg, _ := createEcsMessage(&m, "tst-mesos-slave-001")
+	jq := makeQuery(msg)
+
+	assert.Equal("something happened", getString(jq, "message"))
+	assert.Equal("DEBUG", getString(jq, "log", "level"))
+	assert.Equal("debug.go", getString(jq, "log", "origin", "file", "name"))
+	line, _ := jq.Int("log", "origin", "file", "line")
+	assert.Equal(42, line)
+
+}
+
+func TestCreateEcsMessageWithJsonDataAndNoMessage(t *testing.T) {
+
+	assert := assert.New(t)
+
+	m := router.Message{
+		Container: &docker.Container{
+			ID:   "6feffd9428dc",
+			Name: "/my_app",
+			Config: &docker.Config{
+				Hostname: "container_hostname",
+				Image:    "my.registry.host:443/path/to/image:1234",
+			},
+		},
+		Source: "stdout",
+		Data:   `{ "logtype": "applog", "level": "DEBUG", "file": "debug.go", "line": 42}`,
+		Time:   time.Unix(int64(1453818496), 595000000),
+	}
+
+	msg, _ := createEcsMessage(&m, "tst-mesos-slave-001")
+	jq := makeQuery(msg)
+
+	assert.Equal("no message", getString(jq, "message"))
+
+}
+
+func TestCreateEcsMessageWithUnknownLogtype(t *testing.T) {
+
+	assert := assert.New(t)
+
+	m := router.Message{
+		Container: &docker.Container{
+			ID:   "6feffd9428dc",
+			Name: "/my_app",
+			Config: &docker.Config{
+				Hostname: "container_hostname",
+				Image:    "my.registry.host:443/path/to/image:1234",
+			},
+		},
+		Source: "stdout",
+		Data:   `{ "logtype": "nolog", "message":"here i am!", "level": "DEBUG", "file": "debug.go", "line": 42}`,
+		Time:   time.Unix(int64(1453818496), 595000000),
+	}
+
+	msg, _ := createEcsMessage(&m, "tst-mesos-slave-001")
+	jq := makeQuery(msg)
+
+	assert.Equal("", getString(jq, "event", "dataset"))
+
+}
+
 func TestValidJsonMessageNoJson(t *testing.T) {
 	assert := assert.New(t)
 
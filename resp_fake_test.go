@@ -0,0 +1,193 @@
+package redis
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// respServer is a minimal RESP protocol test double: it accepts TCP
+// connections, decodes inline/multibulk commands, and hands each one to
+// handler to produce the raw RESP-encoded reply. Used below to fake a
+// Redis Sentinel and a Redis master without needing real binaries.
+type respServer struct {
+	ln      net.Listener
+	handler func(args []string) []byte
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func startRespServer(t *testing.T, handler func(args []string) []byte) *respServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("resp fake: listen: %v", err)
+	}
+	s := &respServer{ln: ln, handler: handler}
+	go s.serve()
+	return s
+}
+
+func (s *respServer) addr() string { return s.ln.Addr().String() }
+
+// close stops accepting and drops every open connection, as a crashed
+// server would.
+func (s *respServer) close() {
+	s.ln.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+}
+
+func (s *respServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *respServer) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readRespCommand(r)
+		if err != nil {
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if _, err := conn.Write(s.handler(args)); err != nil {
+			return
+		}
+	}
+}
+
+func readRespCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return nil, nil
+	}
+	if line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		header = strings.TrimRight(header, "\r\n")
+		if len(header) == 0 || header[0] != '$' {
+			return nil, fmt.Errorf("resp fake: expected bulk string header, got %q", header)
+		}
+		size, err := strconv.Atoi(header[1:])
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2) // payload + trailing CRLF
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+func respSimple(s string) []byte { return []byte("+" + s + "\r\n") }
+func respInt(n int) []byte       { return []byte(":" + strconv.Itoa(n) + "\r\n") }
+
+func respArray(items ...string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "*%d\r\n", len(items))
+	for _, it := range items {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(it), it)
+	}
+	return b.Bytes()
+}
+
+// fakeSentinel answers SENTINEL get-master-addr-by-name with whichever
+// address setMaster last recorded, so tests can simulate a failover.
+type fakeSentinel struct {
+	mu   sync.Mutex
+	addr string
+}
+
+func (f *fakeSentinel) setMaster(addr string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.addr = addr
+}
+
+func (f *fakeSentinel) handle(args []string) []byte {
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return respSimple("PONG")
+	case "SENTINEL":
+		if len(args) >= 2 && strings.EqualFold(args[1], "get-master-addr-by-name") {
+			f.mu.Lock()
+			addr := f.addr
+			f.mu.Unlock()
+			host, port, err := net.SplitHostPort(addr)
+			if err != nil {
+				return respArray()
+			}
+			return respArray(host, port)
+		}
+		return respArray()
+	default:
+		return respSimple("OK")
+	}
+}
+
+// fakeMaster records every RPUSH it receives and answers everything else
+// with a generic OK/PONG so client handshakes (AUTH, SELECT, ...) succeed.
+type fakeMaster struct {
+	mu     sync.Mutex
+	pushed [][]string
+}
+
+func (f *fakeMaster) handle(args []string) []byte {
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return respSimple("PONG")
+	case "RPUSH":
+		f.mu.Lock()
+		f.pushed = append(f.pushed, append([]string(nil), args[2:]...))
+		f.mu.Unlock()
+		return respInt(len(args) - 2)
+	default:
+		return respSimple("OK")
+	}
+}
+
+func (f *fakeMaster) pushes() [][]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([][]string(nil), f.pushed...)
+}